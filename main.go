@@ -13,16 +13,13 @@ import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/operable/go-relay/relay/bus"
 	"github.com/operable/go-relay/relay/config"
-	"github.com/operable/go-relay/relay/docker"
+	"github.com/operable/go-relay/relay/engines/docker"
+	"github.com/operable/go-relay/relay/engines/native"
+	relayerrors "github.com/operable/go-relay/relay/errors"
+	"github.com/operable/go-relay/relay/metrics"
 	"github.com/operable/go-relay/relay/worker"
 )
 
-const (
-	BAD_CONFIG = iota + 1
-	DOCKER_ERR
-	BUS_ERR
-)
-
 var configFile = flag.String("file", "/etc/cog_relay.conf", "Path to configuration file")
 
 func init() {
@@ -74,21 +71,111 @@ func prepare() *config.Config {
 	flag.Parse()
 	config, err := config.LoadConfig(*configFile)
 	if err != nil {
+		relayErr := relayerrors.NewBadConfig(err)
 		errstr := fmt.Sprintf("%s", err)
 		msgs := strings.Split(errstr, ";")
 		log.Errorf("Error loading %s:", *configFile)
 		for _, msg := range msgs {
 			log.Errorf("  %s", msg)
 		}
-		os.Exit(BAD_CONFIG)
+		os.Exit(int(relayerrors.ExitCodeFor(relayErr)))
 	}
 	configureLogger(config)
 	return config
 }
 
-func shutdown(config *config.Config, link worker.Service, workQueue *worker.Queue, coordinator sync.WaitGroup) {
-	// Remove signal handler so Ctrl-C works
-	signal.Reset(syscall.SIGINT)
+// configHolder guards the relay's active configuration behind a
+// mutex so handleMessage always sees a consistent snapshot, and a
+// SIGHUP reload can swap it in without a restart. New work briefly
+// pauses while Set holds the write lock during a swap.
+type configHolder struct {
+	mu  sync.RWMutex
+	cfg *config.Config
+}
+
+func (h *configHolder) Get() *config.Config {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.cfg
+}
+
+func (h *configHolder) Set(cfg *config.Config) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.cfg = cfg
+}
+
+// linkHolder guards the relay's active Cog connection behind a mutex
+// so the readiness probe always sees a consistent value to call
+// Connected() on, even while reload is swapping in a freshly
+// reconnected link.
+type linkHolder struct {
+	mu   sync.RWMutex
+	link *bus.Link
+}
+
+func (h *linkHolder) Get() *bus.Link {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.link
+}
+
+func (h *linkHolder) Set(link *bus.Link) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.link = link
+}
+
+// reload re-reads the config file and applies whatever changed:
+// logger settings take effect immediately, the worker pool is
+// resized to the new MaxConcurrent, and the Cog link is only
+// recreated if its endpoint or credentials actually changed. The old
+// link is kept live until a replacement is fully connected and
+// subscribed, so a failed reconnect leaves the relay exactly as
+// reachable as it was and able to retry on the next SIGHUP.
+// In-flight requests are never interrupted.
+func reload(holder *configHolder, pool *worker.Pool, link *linkHolder, subs bus.Subscriptions, workQueue *worker.Queue, coordinator *sync.WaitGroup) {
+	log.Info("Reloading configuration.")
+	oldConfig := holder.Get()
+	newConfig, err := config.LoadConfig(*configFile)
+	if err != nil {
+		log.Errorf("Error reloading %s, keeping current configuration: %s.", *configFile, err)
+		return
+	}
+
+	// configureLogger only ever switches to JSON, so put the text
+	// formatter back first in case LogJSON was turned off.
+	if !newConfig.LogJSON {
+		log.SetFormatter(&log.TextFormatter{FullTimestamp: true, DisableSorting: true})
+	}
+	configureLogger(newConfig)
+	holder.Set(newConfig)
+	pool.Resize(newConfig.MaxConcurrent)
+	log.Infof("Worker pool resized to %d workers.", newConfig.MaxConcurrent)
+
+	if newConfig.Cog != oldConfig.Cog {
+		log.Info("Cog bus settings changed; reconnecting.")
+		newLink, err := bus.NewLink(newConfig.ID, newConfig.Cog, workQueue, subs, coordinator)
+		if err != nil {
+			log.Errorf("Error reconnecting to Cog, keeping existing connection: %s.", err)
+			return
+		}
+		if err := newLink.Run(); err != nil {
+			log.Errorf("Error subscribing to message topics, keeping existing connection: %s.", err)
+			newLink.Halt()
+			return
+		}
+		old := link.Get()
+		link.Set(newLink)
+		old.Halt()
+	}
+	log.Info("Configuration reload complete.")
+}
+
+func shutdown(config *config.Config, link worker.Service, workQueue *worker.Queue, coordinator *sync.WaitGroup) {
+	// Remove signal handlers so Ctrl-C works and a lingering SIGHUP
+	// can't trigger a reload mid-shutdown
+	signal.Reset(syscall.SIGINT, syscall.SIGHUP)
 
 	log.Info("Starting shut down.")
 
@@ -106,14 +193,38 @@ func shutdown(config *config.Config, link worker.Service, workQueue *worker.Queu
 }
 
 func main() {
-	var coordinator sync.WaitGroup
+	coordinator := &sync.WaitGroup{}
 	incomingSignal := make(chan os.Signal, 1)
 
-	// Set up signal handlers
-	signal.Notify(incomingSignal, syscall.SIGINT)
+	// Set up signal handlers. SIGHUP triggers a live config reload;
+	// SIGINT starts a graceful shutdown.
+	signal.Notify(incomingSignal, syscall.SIGINT, syscall.SIGHUP)
 	config := prepare()
 	log.Infof("Configuration file %s loaded.", *configFile)
 	log.Infof("Relay %s is initializing.", config.ID)
+	holder := &configHolder{cfg: config}
+
+	var dockerReady bool
+	linker := &linkHolder{}
+	var metricsServer *metrics.Server
+	if config.Metrics.Enabled {
+		metricsServer = metrics.NewServer(config.Metrics.BindAddress, map[string]metrics.ReadinessCheck{
+			"docker": func() error {
+				if config.DockerDisabled || dockerReady {
+					return nil
+				}
+				return fmt.Errorf("Docker configuration not yet verified")
+			},
+			"bus": func() error {
+				if link := linker.Get(); link != nil && link.Connected() {
+					return nil
+				}
+				return fmt.Errorf("not connected to Cog")
+			},
+		})
+		metricsServer.Start()
+		defer metricsServer.Stop()
+	}
 
 	// Create work queue with some burstable capacity
 	workQueue := worker.NewQueue(config.MaxConcurrent * 2)
@@ -121,27 +232,25 @@ func main() {
 	if config.DockerDisabled == false {
 		err := docker.VerifyConfig(config.Docker)
 		if err != nil {
-			log.Errorf("Error verifying Docker configuration: %s.", err)
+			relayErr := relayerrors.NewDockerUnavailable(err)
+			log.Errorf("Error verifying Docker configuration: %s.", relayErr)
 			shutdown(config, nil, workQueue, coordinator)
-			os.Exit(DOCKER_ERR)
+			os.Exit(int(relayerrors.ExitCodeFor(relayErr)))
 		} else {
 			log.Infof("Docker configuration verified.")
+			dockerReady = true
 		}
 	} else {
 		log.Infof("Docker support disabled.")
 	}
 
 	// Start MaxConcurrent workers
-	for i := 0; i < config.MaxConcurrent; i++ {
-		go func() {
-			worker.RunWorker(workQueue, coordinator)
-		}()
-	}
+	pool := worker.NewPool(workQueue, coordinator, config.MaxConcurrent)
 	log.Infof("Started %d workers.", config.MaxConcurrent)
 
 	// Connect to Cog
 	handler := func(bus worker.MessageBus, topic string, payload []byte) {
-		return
+		handleMessage(workQueue, holder.Get(), bus, topic, payload)
 	}
 	subs := bus.Subscriptions{
 		CommandHandler:   handler,
@@ -151,7 +260,7 @@ func main() {
 	if err != nil {
 		log.Errorf("Error connecting to Cog: %s.", err)
 		shutdown(config, nil, workQueue, coordinator)
-		os.Exit(BUS_ERR)
+		os.Exit(int(relayerrors.ExitCodeFor(err)))
 	}
 
 	log.Infof("Connected to Cog host %s.", config.Cog.Host)
@@ -159,40 +268,115 @@ func main() {
 	if err != nil {
 		log.Errorf("Error subscribing to message topics: %s.", err)
 		shutdown(config, nil, workQueue, coordinator)
-		os.Exit(BUS_ERR)
+		os.Exit(int(relayerrors.ExitCodeFor(err)))
 	}
+	linker.Set(link)
 	log.Infof("Relay %s is ready.", config.ID)
 
-	// Wait until we get a signal
-	<-incomingSignal
+	// Wait for a signal, reloading on SIGHUP and shutting down on
+	// everything else we're notified of.
+	for sig := range incomingSignal {
+		if sig == syscall.SIGHUP {
+			reload(holder, pool, linker, subs, workQueue, coordinator)
+			continue
+		}
+		break
+	}
 
 	// Shutdown
-	shutdown(config, link, workQueue, coordinator)
+	shutdown(holder.Get(), linker.Get(), workQueue, coordinator)
 }
 
 func handleMessage(queue *worker.Queue, config *config.Config, bus worker.MessageBus, topic string, payload []byte) {
-	engine, err := newDockerEngine(config)
+	// TODO: derive the bundle being invoked from payload once the
+	// invocation envelope is parsed; until then the topic stands in
+	// for bundle selection.
+	bundle := topic
+	deadLetterTopic := fmt.Sprintf("bot/relays/%s/dead-letter", config.ID)
+	engine, err := newEngine(config, bundle)
 	if err != nil {
-		log.Errorf("Error connecting to Docker: %s", err)
-		//TODO Send error to Cog
+		log.Errorf("Error preparing execution engine for bundle %s: %s", bundle, err)
+		bus.PublishError(topic, err)
+		if !relayerrors.IsTransient(err) {
+			publishDeadLetter(bus, topic, deadLetterTopic, payload, err)
+		}
 		return
 	}
+	if err := engine.Prepare(bundle); err != nil {
+		log.Errorf("Error preparing bundle %s: %s", bundle, err)
+		bus.PublishError(topic, err)
+		publishDeadLetter(bus, topic, deadLetterTopic, payload, err)
+		return
+	}
+	limits := config.Limits.For(bundle)
 	request := &worker.Request{
-		Bus:          bus,
-		DockerEngine: engine,
-		Topic:        topic,
-		Message:      payload,
+		Bus:             bus,
+		Engine:          engine,
+		Topic:           topic,
+		Message:         payload,
+		MaxAttempts:     config.Retry.MaxAttempts,
+		BaseDelay:       config.Retry.BaseDelay,
+		MaxDelay:        config.Retry.MaxDelay,
+		DeadLetterTopic: deadLetterTopic,
+		CPUQuota:        limits.CPUQuota,
+		MemoryBytes:     limits.MemoryBytes,
+		PidsLimit:       limits.PidsLimit,
+		Timeout:         limits.Timeout,
 	}
 	queue.Enqueue(request)
 }
 
-func newDockerEngine(config *config.Config) (*docker.Engine, error) {
-	if config.DockerDisabled == false {
+// publishDeadLetter publishes payload to deadLetterTopic wrapped in
+// the same worker.DeadLetterEnvelope the retry subsystem uses, so a
+// request that never reaches the queue looks the same to an operator
+// replaying the dead-letter topic as one that exhausted its retries.
+func publishDeadLetter(bus worker.MessageBus, topic, deadLetterTopic string, payload []byte, cause error) {
+	envelope, err := worker.BuildDeadLetterPayload(topic, payload, 0, cause)
+	if err != nil {
+		log.Errorf("Error marshaling dead-letter envelope for topic %s: %s.", topic, err)
+		return
+	}
+	if err := bus.Publish(deadLetterTopic, envelope); err != nil {
+		log.Errorf("Error publishing to dead-letter topic %s: %s.", deadLetterTopic, err)
+		return
+	}
+	metrics.DeadLetterCount.Inc()
+}
+
+// newEngine selects and builds a fresh worker.ExecutionEngine to run
+// bundle's next command, honoring a per-bundle override in
+// config.Engines.BundleOverrides and falling back to the configured
+// default engine. It is called anew for every invocation; nothing
+// about the engine (a client connection, a container) is reused
+// across calls, trading some per-message cost for never sharing
+// engine state between concurrent or successive invocations.
+func newEngine(config *config.Config, bundle string) (worker.ExecutionEngine, error) {
+	name, ok := config.Engines.BundleOverrides[bundle]
+	if !ok {
+		name = config.Engines.Default
+	}
+	switch name {
+	case "docker":
+		if config.DockerDisabled {
+			return nil, relayerrors.NewDockerUnavailable(fmt.Errorf("Docker support is disabled"))
+		}
 		engine, err := docker.NewEngine(config.Docker)
 		if err != nil {
-			return engine, nil
+			return nil, relayerrors.NewDockerUnavailable(err)
 		}
-		return nil, err
+		return engine, nil
+	case "native":
+		if !config.Native.Enabled {
+			return nil, fmt.Errorf("native engine requested but not enabled")
+		}
+		return native.NewEngine(config.Native)
+	case "kubernetes":
+		// kubernetes.Engine.Execute is not implemented yet (see that
+		// package's doc comment), so unlike docker/native this engine
+		// can never actually run a command. Refuse to select it at all
+		// rather than accepting every invocation only to fail it.
+		return nil, fmt.Errorf("kubernetes engine is not yet implemented; select docker or native instead")
+	default:
+		return nil, fmt.Errorf("unknown execution engine %q", name)
 	}
-	return nil, nil
 }
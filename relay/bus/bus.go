@@ -0,0 +1,155 @@
+// Package bus manages the relay's MQTT connection to Cog, dispatching
+// incoming command and execution messages to the worker queue.
+package bus
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/operable/go-relay/relay/config"
+	relayerrors "github.com/operable/go-relay/relay/errors"
+	"github.com/operable/go-relay/relay/metrics"
+	"github.com/operable/go-relay/relay/worker"
+)
+
+// errorEnvelope is the structured error payload published back to
+// Cog when a request fails, letting Cog render an actionable message
+// instead of an opaque failure.
+type errorEnvelope struct {
+	Code    relayerrors.Code  `json:"code"`
+	Message string            `json:"message"`
+	Context map[string]string `json:"context,omitempty"`
+}
+
+// Handler processes a single message received on topic.
+type Handler func(bus worker.MessageBus, topic string, payload []byte)
+
+// Subscriptions wires topic handlers for the message classes the
+// relay cares about.
+type Subscriptions struct {
+	CommandHandler   Handler
+	ExecutionHandler Handler
+}
+
+// Link owns the MQTT connection to Cog and routes incoming messages
+// to the work queue.
+type Link struct {
+	id             string
+	config         config.Cog
+	client         MQTT.Client
+	queue          *worker.Queue
+	subs           Subscriptions
+	wg             sync.WaitGroup
+	halted         bool
+	haltMux        sync.Mutex
+	disconnectedAt time.Time
+}
+
+// NewLink creates a Link and connects it to the configured Cog host.
+func NewLink(id string, cfg config.Cog, queue *worker.Queue, subs Subscriptions, coordinator *sync.WaitGroup) (*Link, error) {
+	link := &Link{
+		id:     id,
+		config: cfg,
+		queue:  queue,
+		subs:   subs,
+	}
+	opts := MQTT.NewClientOptions().
+		AddBroker(fmt.Sprintf("tcp://%s:%d", cfg.Host, cfg.Port)).
+		SetClientID(id).
+		SetUsername(cfg.User).
+		SetPassword(cfg.Password).
+		SetAutoReconnect(true).
+		SetConnectionLostHandler(link.onConnectionLost).
+		SetOnConnectHandler(link.onConnect)
+	link.client = MQTT.NewClient(opts)
+	if token := link.client.Connect(); token.Wait() && token.Error() != nil {
+		return nil, relayerrors.NewBusUnavailable(fmt.Errorf("connecting to Cog host %s: %s", cfg.Host, token.Error()))
+	}
+	// The initial connection is counted by onConnect, which the MQTT
+	// client calls on every successful connect, not only reconnects.
+	return link, nil
+}
+
+func (l *Link) onConnectionLost(client MQTT.Client, err error) {
+	log.Warnf("Lost connection to Cog: %s.", err)
+	metrics.BusDisconnects.Inc()
+	l.disconnectedAt = time.Now()
+}
+
+func (l *Link) onConnect(client MQTT.Client) {
+	metrics.BusConnects.Inc()
+	if !l.disconnectedAt.IsZero() {
+		metrics.BusReconnectDuration.Observe(time.Since(l.disconnectedAt).Seconds())
+		l.disconnectedAt = time.Time{}
+	}
+}
+
+// Connected reports whether the link currently has a live connection
+// to Cog.
+func (l *Link) Connected() bool {
+	return l.client != nil && l.client.IsConnected()
+}
+
+// Run subscribes to the command and execution topics for this relay.
+func (l *Link) Run() error {
+	topics := map[string]Handler{
+		fmt.Sprintf("bot/relays/%s/directives", l.id): l.subs.CommandHandler,
+		fmt.Sprintf("bot/relays/%s/executions", l.id): l.subs.ExecutionHandler,
+	}
+	for topic, handler := range topics {
+		handler := handler
+		token := l.client.Subscribe(topic, 1, func(client MQTT.Client, msg MQTT.Message) {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Errorf("Message handler panicked for topic %s: %v.", msg.Topic(), r)
+					metrics.MarkPanic()
+				}
+			}()
+			handler(l, msg.Topic(), msg.Payload())
+		})
+		if token.Wait() && token.Error() != nil {
+			return relayerrors.NewBusUnavailable(fmt.Errorf("subscribing to %s: %s", topic, token.Error()))
+		}
+	}
+	return nil
+}
+
+// Publish sends payload to topic on the Cog bus.
+func (l *Link) Publish(topic string, payload []byte) error {
+	token := l.client.Publish(topic, 1, false, payload)
+	token.Wait()
+	return token.Error()
+}
+
+// PublishError marshals err into a structured error envelope and
+// publishes it to topic, so Cog can render an actionable message to
+// the end user instead of an opaque failure.
+func (l *Link) PublishError(topic string, err error) error {
+	envelope := errorEnvelope{Message: err.Error()}
+	if relayErr, ok := err.(*relayerrors.Error); ok {
+		envelope.Code = relayErr.Code
+		envelope.Message = relayErr.Message
+		envelope.Context = relayErr.Context
+	}
+	payload, marshalErr := json.Marshal(envelope)
+	if marshalErr != nil {
+		return marshalErr
+	}
+	return l.Publish(topic, payload)
+}
+
+// Halt disconnects from Cog. It is safe to call more than once.
+func (l *Link) Halt() {
+	l.haltMux.Lock()
+	defer l.haltMux.Unlock()
+	if l.halted {
+		return
+	}
+	l.halted = true
+	log.Info("Disconnecting from Cog.")
+	l.client.Disconnect(250)
+}
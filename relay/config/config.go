@@ -0,0 +1,169 @@
+// Package config loads and validates the relay's configuration file.
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-ini/ini"
+)
+
+// Docker holds settings for talking to a Docker daemon.
+type Docker struct {
+	SocketPath string
+	UseEnv     bool
+}
+
+// Native holds settings for the native (direct host process)
+// execution engine.
+type Native struct {
+	Enabled   bool
+	Whitelist []string
+}
+
+// Kubernetes holds settings for the Kubernetes execution engine.
+type Kubernetes struct {
+	Enabled        bool
+	KubeconfigPath string
+	Namespace      string
+}
+
+// Engines selects which execution engines are active and which one
+// runs a given bundle's commands.
+type Engines struct {
+	Default         string
+	BundleOverrides map[string]string
+}
+
+// Cog holds settings for connecting to the Cog message bus.
+type Cog struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+}
+
+// Metrics holds settings for the Prometheus/health HTTP server.
+type Metrics struct {
+	Enabled     bool
+	BindAddress string
+}
+
+// Retry holds settings for the retry-with-backoff and dead-letter
+// behavior applied to failed command executions.
+type Retry struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// Limits bounds the resources a single command invocation may use:
+// CPUQuota is microseconds of CPU time per 100ms period (Docker's
+// CPUQuota/CPUPeriod convention), MemoryBytes and PidsLimit cap
+// container memory and process count, and Timeout is the wall-clock
+// budget before the command is killed.
+type Limits struct {
+	CPUQuota    int64
+	MemoryBytes int64
+	PidsLimit   int64
+	Timeout     time.Duration
+}
+
+// clamp returns a copy of l with each field capped to the
+// corresponding ceiling field, where the ceiling is set (non-zero).
+func (l Limits) clamp(ceiling Limits) Limits {
+	if ceiling.CPUQuota > 0 && (l.CPUQuota <= 0 || l.CPUQuota > ceiling.CPUQuota) {
+		l.CPUQuota = ceiling.CPUQuota
+	}
+	if ceiling.MemoryBytes > 0 && (l.MemoryBytes <= 0 || l.MemoryBytes > ceiling.MemoryBytes) {
+		l.MemoryBytes = ceiling.MemoryBytes
+	}
+	if ceiling.PidsLimit > 0 && (l.PidsLimit <= 0 || l.PidsLimit > ceiling.PidsLimit) {
+		l.PidsLimit = ceiling.PidsLimit
+	}
+	if ceiling.Timeout > 0 && (l.Timeout <= 0 || l.Timeout > ceiling.Timeout) {
+		l.Timeout = ceiling.Timeout
+	}
+	return l
+}
+
+// LimitsConfig holds the global default resource limits, a per-bundle
+// override table, and a hard ceiling no bundle's limits may exceed.
+type LimitsConfig struct {
+	Default         Limits
+	Ceiling         Limits
+	BundleOverrides map[string]Limits
+}
+
+// For resolves the effective Limits for bundle: the configured
+// default, overridden per-bundle if set, and always clamped to the
+// ceiling so no bundle can starve the relay host.
+func (c LimitsConfig) For(bundle string) Limits {
+	limits := c.Default
+	if override, ok := c.BundleOverrides[bundle]; ok {
+		limits = override
+	}
+	return limits.clamp(c.Ceiling)
+}
+
+// Config is the top level relay configuration, assembled from the
+// relay's config file.
+type Config struct {
+	ID             string
+	MaxConcurrent  int
+	LogPath        string
+	LogLevel       string
+	LogJSON        bool
+	DockerDisabled bool
+	Docker         Docker
+	Native         Native
+	Kubernetes     Kubernetes
+	Engines        Engines
+	Cog            Cog
+	Metrics        Metrics
+	Retry          Retry
+	Limits         LimitsConfig
+}
+
+// LoadConfig reads and validates the configuration file at path,
+// returning a populated Config or a descriptive error.
+func LoadConfig(path string) (*Config, error) {
+	file, err := ini.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %s", path, err)
+	}
+	config := &Config{
+		MaxConcurrent: 4,
+		LogPath:       "stdout",
+		LogLevel:      "info",
+		Engines: Engines{
+			Default: "docker",
+		},
+		Metrics: Metrics{
+			BindAddress: ":8080",
+		},
+		Retry: Retry{
+			MaxAttempts: 5,
+			BaseDelay:   500 * time.Millisecond,
+			MaxDelay:    30 * time.Second,
+		},
+		Limits: LimitsConfig{
+			Default: Limits{
+				CPUQuota:    100000,
+				MemoryBytes: 256 * 1024 * 1024,
+				PidsLimit:   128,
+				Timeout:     30 * time.Second,
+			},
+			Ceiling: Limits{
+				CPUQuota:    400000,
+				MemoryBytes: 2 * 1024 * 1024 * 1024,
+				PidsLimit:   512,
+				Timeout:     10 * time.Minute,
+			},
+		},
+	}
+	if err := file.MapTo(config); err != nil {
+		return nil, fmt.Errorf("parsing %s: %s", path, err)
+	}
+	return config, nil
+}
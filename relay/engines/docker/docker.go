@@ -0,0 +1,181 @@
+// Package docker implements the worker.ExecutionEngine that runs
+// bundle commands inside Docker containers.
+package docker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/operable/go-relay/relay/config"
+	relayerrors "github.com/operable/go-relay/relay/errors"
+	"github.com/operable/go-relay/relay/metrics"
+	"github.com/operable/go-relay/relay/worker"
+)
+
+// Engine owns a connection to a Docker daemon and is used to create,
+// run and tear down the containers that execute bundle commands.
+type Engine struct {
+	client      *dockerclient.Client
+	config      config.Docker
+	image       string
+	containerID string
+}
+
+// VerifyConfig checks that the configured Docker daemon is reachable
+// and usable before the relay starts accepting work.
+func VerifyConfig(cfg config.Docker) error {
+	client, err := newClient(cfg)
+	if err != nil {
+		return err
+	}
+	if err := client.Ping(); err != nil {
+		return fmt.Errorf("pinging Docker daemon: %s", err)
+	}
+	return nil
+}
+
+// NewEngine creates an Engine connected to the configured Docker
+// daemon.
+func NewEngine(cfg config.Docker) (*Engine, error) {
+	client, err := newClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Engine{client: client, config: cfg}, nil
+}
+
+func newClient(cfg config.Docker) (*dockerclient.Client, error) {
+	if cfg.UseEnv {
+		return dockerclient.NewClientFromEnv()
+	}
+	return dockerclient.NewClient(cfg.SocketPath)
+}
+
+// Name identifies this engine as required by worker.ExecutionEngine.
+func (e *Engine) Name() string {
+	return "docker"
+}
+
+// Prepare pulls the image backing bundle so it is ready to run
+// commands without a cold-start delay on first invocation.
+func (e *Engine) Prepare(bundle string) (err error) {
+	start := time.Now()
+	defer func() { observe("pull", start, err) }()
+	if pullErr := e.client.PullImage(
+		dockerclient.PullImageOptions{Repository: bundle},
+		dockerclient.AuthConfiguration{},
+	); pullErr != nil {
+		err = relayerrors.NewImagePullFailed(bundle, pullErr)
+		return err
+	}
+	e.image = bundle
+	return nil
+}
+
+// Execute creates a container from the bundle image honoring
+// request's resource limits, runs the requested command in it and
+// captures its output. If ctx is cancelled before the command
+// finishes, the container is force-killed and a CodeCommandTimeout
+// error is returned.
+func (e *Engine) Execute(ctx context.Context, request *worker.Request) (stdout string, stderr string, exitCode int, err error) {
+	start := time.Now()
+	defer func() { observe("exec", start, err) }()
+
+	if e.containerID == "" {
+		if createErr := e.createContainer(request); createErr != nil {
+			err = relayerrors.NewExecutionFailed(createErr)
+			return "", "", -1, err
+		}
+	}
+
+	exec, createErr := e.client.CreateExec(dockerclient.CreateExecOptions{
+		Container:    e.containerID,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if createErr != nil {
+		err = relayerrors.NewExecutionFailed(createErr)
+		return "", "", -1, err
+	}
+
+	done := make(chan error, 1)
+	var inspectResult dockerclient.ExecInspect
+	var outBuf, errBuf bytes.Buffer
+	go func() {
+		if startErr := e.client.StartExec(exec.ID, dockerclient.StartExecOptions{
+			OutputStream: &outBuf,
+			ErrorStream:  &errBuf,
+		}); startErr != nil {
+			done <- startErr
+			return
+		}
+		inspect, inspectErr := e.client.InspectExec(exec.ID)
+		if inspectErr != nil {
+			done <- inspectErr
+			return
+		}
+		inspectResult = *inspect
+		done <- nil
+	}()
+
+	select {
+	case runErr := <-done:
+		if runErr != nil {
+			err = relayerrors.NewExecutionFailed(runErr)
+			return "", "", -1, err
+		}
+		return outBuf.String(), errBuf.String(), inspectResult.ExitCode, nil
+	case <-ctx.Done():
+		e.client.KillContainer(dockerclient.KillContainerOptions{ID: e.containerID})
+		err = relayerrors.NewCommandTimeout(request.Topic)
+		return "", "", -1, err
+	}
+}
+
+// createContainer creates the container this engine will run
+// commands in from the image set by Prepare, applying request's CPU,
+// memory and PIDs limits.
+func (e *Engine) createContainer(request *worker.Request) error {
+	pidsLimit := request.PidsLimit
+	container, err := e.client.CreateContainer(dockerclient.CreateContainerOptions{
+		Config: &dockerclient.Config{
+			Image: e.image,
+		},
+		HostConfig: &dockerclient.HostConfig{
+			CPUQuota:  request.CPUQuota,
+			CPUPeriod: 100000,
+			Memory:    request.MemoryBytes,
+			PidsLimit: &pidsLimit,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	e.containerID = container.ID
+	return nil
+}
+
+// Cleanup removes the container created for this engine, if any.
+func (e *Engine) Cleanup() (err error) {
+	if e.containerID == "" {
+		return nil
+	}
+	start := time.Now()
+	defer func() { observe("remove", start, err) }()
+	return e.client.RemoveContainer(dockerclient.RemoveContainerOptions{
+		ID:    e.containerID,
+		Force: true,
+	})
+}
+
+func observe(operation string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	metrics.DockerOperations.WithLabelValues(operation, result).Inc()
+	metrics.DockerOperationDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,76 @@
+// Package kubernetes implements the worker.ExecutionEngine that will
+// run each bundle command invocation as a short-lived Job/Pod against
+// a configured Kubernetes cluster. Connection setup and Prepare's
+// namespace check are wired up, but Execute is not yet implemented:
+// selecting this engine fails every invocation until that lands.
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/operable/go-relay/relay/config"
+	"github.com/operable/go-relay/relay/worker"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Engine holds a Kubernetes client for a configured namespace. It
+// submits no Jobs: Execute returns an error for every invocation.
+type Engine struct {
+	config    config.Kubernetes
+	clientset *kubernetes.Clientset
+}
+
+// NewEngine builds a Kubernetes Engine from the given kubeconfig
+// path and namespace/target settings.
+func NewEngine(cfg config.Kubernetes) (*Engine, error) {
+	restConfig, err := clientcmd.BuildConfigFromFlags("", cfg.KubeconfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("loading kubeconfig %s: %s", cfg.KubeconfigPath, err)
+	}
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("building Kubernetes client: %s", err)
+	}
+	return &Engine{config: cfg, clientset: clientset}, nil
+}
+
+// Name identifies this engine as required by worker.ExecutionEngine.
+func (e *Engine) Name() string {
+	return "kubernetes"
+}
+
+// Prepare verifies the configured namespace is reachable before the
+// bundle's first invocation.
+func (e *Engine) Prepare(bundle string) error {
+	_, err := e.clientset.CoreV1().Namespaces().Get(e.config.Namespace, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("verifying namespace %s: %s", e.config.Namespace, err)
+	}
+	return nil
+}
+
+// Execute will submit a Job that runs the requested command and
+// waits for it to complete, returning the Pod's captured logs. The
+// Job's container resources would be set from request's
+// CPU/memory/PIDs limits and request.Timeout would become the Job's
+// activeDeadlineSeconds; if ctx is cancelled first the Job would be
+// deleted and a CodeCommandTimeout error returned.
+//
+// None of that is implemented yet: this engine is not ready for
+// production use, and every invocation fails until it is. Do not
+// enable it for a bundle expecting working execution.
+func (e *Engine) Execute(ctx context.Context, request *worker.Request) (stdout string, stderr string, exitCode int, err error) {
+	// TODO: build a batchv1.Job from request (setting resource
+	// requests/limits and activeDeadlineSeconds from request.Timeout),
+	// submit it to e.config.Namespace, wait for completion or ctx.Done,
+	// and fetch logs/exit code from the resulting Pod.
+	return "", "", -1, fmt.Errorf("kubernetes engine execution is not yet implemented")
+}
+
+// Cleanup removes any Jobs/Pods this engine has created.
+func (e *Engine) Cleanup() error {
+	return nil
+}
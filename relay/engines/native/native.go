@@ -0,0 +1,88 @@
+// Package native implements the worker.ExecutionEngine that runs
+// bundle commands as whitelisted host binaries, for trusted bundles
+// in environments where Docker is unavailable.
+package native
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+
+	"github.com/operable/go-relay/relay/config"
+	relayerrors "github.com/operable/go-relay/relay/errors"
+	"github.com/operable/go-relay/relay/worker"
+)
+
+// Engine runs bundle commands as direct host processes. Only
+// binaries listed in the configured whitelist may be executed.
+type Engine struct {
+	config config.Native
+}
+
+// NewEngine creates a native Engine using the given whitelist
+// configuration.
+func NewEngine(cfg config.Native) (*Engine, error) {
+	return &Engine{config: cfg}, nil
+}
+
+// Name identifies this engine as required by worker.ExecutionEngine.
+func (e *Engine) Name() string {
+	return "native"
+}
+
+// Prepare verifies that bundle's binary is on the configured
+// whitelist before any commands are run.
+func (e *Engine) Prepare(bundle string) error {
+	if !e.allowed(bundle) {
+		return relayerrors.NewBundleNotFound(bundle)
+	}
+	return nil
+}
+
+// Execute runs the command described by request as a host process,
+// honoring ctx's deadline, and captures its output. Native processes
+// don't support CPU/memory/PIDs limits the way a container does, so
+// only request.Timeout (via ctx) is enforced.
+func (e *Engine) Execute(ctx context.Context, request *worker.Request) (stdout string, stderr string, exitCode int, err error) {
+	// TODO: derive the binary and arguments for request from
+	// request.Message once the bundle/command invocation format is
+	// wired through.
+	binary := request.Topic
+	if !e.allowed(binary) {
+		return "", "", -1, relayerrors.NewBundleNotFound(binary)
+	}
+
+	var outBuf, errBuf bytes.Buffer
+	cmd := exec.CommandContext(ctx, binary)
+	cmd.Stdout = &outBuf
+	cmd.Stderr = &errBuf
+	runErr := cmd.Run()
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return outBuf.String(), errBuf.String(), -1, relayerrors.NewCommandTimeout(binary)
+	}
+
+	code := 0
+	if exitErr, ok := runErr.(*exec.ExitError); ok {
+		code = exitErr.ExitCode()
+		runErr = nil
+	} else if runErr != nil {
+		code = -1
+	}
+	return outBuf.String(), errBuf.String(), code, runErr
+}
+
+// Cleanup is a no-op for the native engine; it holds no resources
+// between invocations.
+func (e *Engine) Cleanup() error {
+	return nil
+}
+
+func (e *Engine) allowed(name string) bool {
+	for _, candidate := range e.config.Whitelist {
+		if candidate == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+// Package errors defines the relay's structured error taxonomy.
+// Instead of propagating bare strings, relay code returns a *Error
+// carrying a stable machine-readable code, a message suitable for
+// showing to a Cog end user, and optional context fields, so callers
+// can branch on error category and the bus layer can surface
+// actionable errors back to Cog.
+package errors
+
+import (
+	"fmt"
+)
+
+// Code is a stable, machine-readable error category.
+type Code string
+
+// Error categories the relay can produce.
+const (
+	CodeBadConfig         Code = "bad_config"
+	CodeDockerUnavailable Code = "docker_unavailable"
+	CodeImagePullFailed   Code = "image_pull_failed"
+	CodeBundleNotFound    Code = "bundle_not_found"
+	CodeCommandTimeout    Code = "command_timeout"
+	CodeExecutionFailed   Code = "execution_failed"
+	CodeBusUnavailable    Code = "bus_unavailable"
+)
+
+// Error is the relay's structured error type. It satisfies the error
+// interface and unwraps to the underlying cause, if any.
+type Error struct {
+	Code    Code
+	Message string
+	Context map[string]string
+	Cause   error
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("%s: %s", e.Message, e.Cause)
+	}
+	return e.Message
+}
+
+// Unwrap allows errors.Is/errors.As to see through to Cause.
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// WithContext returns a copy of e with key set to value in its
+// Context map.
+func (e *Error) WithContext(key, value string) *Error {
+	ctx := make(map[string]string, len(e.Context)+1)
+	for k, v := range e.Context {
+		ctx[k] = v
+	}
+	ctx[key] = value
+	return &Error{Code: e.Code, Message: e.Message, Context: ctx, Cause: e.Cause}
+}
+
+// NewBadConfig wraps a configuration loading/parsing failure.
+func NewBadConfig(cause error) *Error {
+	return &Error{Code: CodeBadConfig, Message: "relay configuration is invalid", Cause: cause}
+}
+
+// NewDockerUnavailable wraps a failure to reach or use the configured
+// Docker daemon.
+func NewDockerUnavailable(cause error) *Error {
+	return &Error{Code: CodeDockerUnavailable, Message: "Docker is unavailable", Cause: cause}
+}
+
+// NewImagePullFailed wraps a failure to pull a bundle's image.
+func NewImagePullFailed(image string, cause error) *Error {
+	return (&Error{Code: CodeImagePullFailed, Message: "failed to pull bundle image", Cause: cause}).
+		WithContext("image", image)
+}
+
+// NewBundleNotFound reports that bundle has no installed implementation
+// for the relay to invoke.
+func NewBundleNotFound(bundle string) *Error {
+	return (&Error{Code: CodeBundleNotFound, Message: "bundle not found"}).
+		WithContext("bundle", bundle)
+}
+
+// NewCommandTimeout reports that command exceeded its execution
+// timeout and was killed.
+func NewCommandTimeout(command string) *Error {
+	return (&Error{Code: CodeCommandTimeout, Message: "command timed out"}).
+		WithContext("command", command)
+}
+
+// NewExecutionFailed wraps a command execution failure that isn't
+// more specifically categorized.
+func NewExecutionFailed(cause error) *Error {
+	return &Error{Code: CodeExecutionFailed, Message: "command execution failed", Cause: cause}
+}
+
+// NewBusUnavailable wraps a failure to connect to, or stay connected
+// to, the Cog message bus.
+func NewBusUnavailable(cause error) *Error {
+	return &Error{Code: CodeBusUnavailable, Message: "Cog message bus is unavailable", Cause: cause}
+}
+
+// transientCodes are error categories worth retrying: the kind of
+// failure that may well succeed on a later attempt (a daemon blip, a
+// slow registry, a dropped bus connection) rather than a permanent
+// problem with the request itself.
+var transientCodes = map[Code]bool{
+	CodeDockerUnavailable: true,
+	CodeImagePullFailed:   true,
+	CodeBusUnavailable:    true,
+}
+
+// IsTransient reports whether err represents a failure worth
+// retrying. Errors that aren't a *Error, and categories like
+// CodeBundleNotFound or CodeCommandTimeout that won't be fixed by
+// trying again, are not transient.
+func IsTransient(err error) bool {
+	relayErr, ok := err.(*Error)
+	if !ok {
+		return false
+	}
+	return transientCodes[relayErr.Code]
+}
+
+// Is reports whether err is, or wraps, a *Error with the given code.
+func Is(err error, code Code) bool {
+	for err != nil {
+		if relayErr, ok := err.(*Error); ok && relayErr.Code == code {
+			return true
+		}
+		wrapper, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			return false
+		}
+		err = wrapper.Unwrap()
+	}
+	return false
+}
+
+// ExitCode is a relay process exit status, one per error category
+// that can cause main() to abort startup.
+type ExitCode int
+
+// Exit codes returned by main() for each class of startup failure.
+const (
+	ExitBadConfig ExitCode = iota + 1
+	ExitDockerError
+	ExitBusError
+)
+
+// ExitCodeFor maps err to the process exit code main() should use. It
+// returns ExitDockerError for error categories with no more specific
+// mapping, matching the relay's historical default.
+func ExitCodeFor(err error) ExitCode {
+	relayErr, ok := err.(*Error)
+	if !ok {
+		return ExitDockerError
+	}
+	switch relayErr.Code {
+	case CodeBadConfig:
+		return ExitBadConfig
+	case CodeBusUnavailable:
+		return ExitBusError
+	default:
+		return ExitDockerError
+	}
+}
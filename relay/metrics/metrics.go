@@ -0,0 +1,199 @@
+// Package metrics exposes the relay's Prometheus metrics plus
+// Kubernetes-style health and readiness endpoints over HTTP.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// QueueDepth tracks the number of requests currently buffered in
+	// the work queue.
+	QueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "relay_queue_depth",
+		Help: "Number of requests currently buffered in the work queue.",
+	})
+
+	// QueueEnqueued counts requests added to the work queue.
+	QueueEnqueued = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "relay_queue_enqueued_total",
+		Help: "Total number of requests enqueued.",
+	})
+
+	// QueueDequeued counts requests pulled off the work queue by a
+	// worker.
+	QueueDequeued = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "relay_queue_dequeued_total",
+		Help: "Total number of requests dequeued by a worker.",
+	})
+
+	// WorkerInFlight tracks the number of command executions
+	// currently in progress.
+	WorkerInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "relay_worker_in_flight",
+		Help: "Number of command executions currently in progress.",
+	})
+
+	// CommandDuration observes how long a command execution takes,
+	// labeled by bundle and command.
+	CommandDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "relay_command_duration_seconds",
+		Help: "Command execution latency in seconds.",
+	}, []string{"bundle", "command"})
+
+	// CommandResults counts command executions by outcome, labeled by
+	// bundle and command.
+	CommandResults = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "relay_command_results_total",
+		Help: "Total number of command executions by result.",
+	}, []string{"bundle", "command", "result"})
+
+	// BusConnects counts successful connections to the Cog message
+	// bus.
+	BusConnects = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "relay_bus_connects_total",
+		Help: "Total number of successful connections to Cog.",
+	})
+
+	// BusDisconnects counts disconnections from the Cog message bus.
+	BusDisconnects = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "relay_bus_disconnects_total",
+		Help: "Total number of disconnections from Cog.",
+	})
+
+	// BusReconnectDuration observes how long a reconnect to Cog took.
+	BusReconnectDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name: "relay_bus_reconnect_duration_seconds",
+		Help: "Time taken to reconnect to Cog, in seconds.",
+	})
+
+	// DockerOperations counts Docker engine operations by kind and
+	// outcome.
+	DockerOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "relay_docker_operations_total",
+		Help: "Total number of Docker engine operations by kind and result.",
+	}, []string{"operation", "result"})
+
+	// DockerOperationDuration observes how long Docker engine
+	// operations take, labeled by kind.
+	DockerOperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "relay_docker_operation_duration_seconds",
+		Help: "Docker engine operation latency in seconds.",
+	}, []string{"operation"})
+
+	// RetryAttempts counts requests requeued for a retry after a
+	// transient failure.
+	RetryAttempts = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "relay_retry_attempts_total",
+		Help: "Total number of requests requeued for retry after a transient failure.",
+	})
+
+	// DeadLetterCount counts requests published to the dead-letter
+	// topic after exhausting retries or failing non-transiently.
+	DeadLetterCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "relay_dead_letter_total",
+		Help: "Total number of requests published to the dead-letter topic.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		QueueDepth,
+		QueueEnqueued,
+		QueueDequeued,
+		WorkerInFlight,
+		CommandDuration,
+		CommandResults,
+		BusConnects,
+		BusDisconnects,
+		BusReconnectDuration,
+		DockerOperations,
+		DockerOperationDuration,
+		RetryAttempts,
+		DeadLetterCount,
+	)
+}
+
+// ReadinessCheck reports whether a dependency the relay needs is
+// currently usable. A nil error means ready.
+type ReadinessCheck func() error
+
+// panicked records that some goroutine was recovered from a panic.
+// It is process-wide rather than per-Server since a recovered panic
+// anywhere in the relay means the process is in a suspect state,
+// regardless of which Server instance's /healthz is being polled.
+var panicked int32
+
+// MarkPanic records that a goroutine was recovered from a panic,
+// which causes /healthz to start failing. Callers should invoke this
+// from a deferred recover() in any goroutine that isn't allowed to
+// take the whole process down with it.
+func MarkPanic() {
+	atomic.StoreInt32(&panicked, 1)
+}
+
+// Server serves /metrics, /healthz and /readyz over HTTP.
+type Server struct {
+	httpServer *http.Server
+	checks     map[string]ReadinessCheck
+}
+
+// NewServer creates a metrics Server bound to addr. Readiness checks
+// are consulted by /readyz; a relay is not ready until all of them
+// succeed.
+func NewServer(addr string, checks map[string]ReadinessCheck) *Server {
+	server := &Server{checks: checks}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", server.handleHealthz)
+	mux.HandleFunc("/readyz", server.handleReadyz)
+	server.httpServer = &http.Server{Addr: addr, Handler: mux}
+	return server
+}
+
+// Start begins serving in the background. Errors other than a clean
+// shutdown are logged.
+func (s *Server) Start() {
+	go func() {
+		log.Infof("Metrics server listening on %s.", s.httpServer.Addr)
+		if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Errorf("Metrics server error: %s.", err)
+		}
+	}()
+}
+
+// Stop gracefully shuts the metrics server down.
+func (s *Server) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		log.Errorf("Error stopping metrics server: %s.", err)
+	}
+}
+
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&panicked) != 0 {
+		http.Error(w, "a goroutine panicked and was recovered", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	for name, check := range s.checks {
+		if err := check(); err != nil {
+			http.Error(w, name+": "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
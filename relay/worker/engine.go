@@ -0,0 +1,30 @@
+package worker
+
+import "context"
+
+// ExecutionEngine runs bundle commands on some backend (Docker,
+// a native host process, Kubernetes, ...). The relay builds a fresh
+// engine for every invocation and calls Cleanup on it once that
+// invocation finishes, so no state (a container, a client connection)
+// is ever shared between concurrent or successive invocations of the
+// same bundle.
+type ExecutionEngine interface {
+	// Name identifies the engine, e.g. "docker", "native" or
+	// "kubernetes". Used in logs.
+	Name() string
+
+	// Prepare readies the engine to run commands from bundle,
+	// e.g. pulling an image or verifying a binary is whitelisted.
+	Prepare(bundle string) error
+
+	// Execute runs the command described by request and returns its
+	// captured stdout, stderr and exit code. Implementations must
+	// honor ctx's deadline, force-killing the underlying process and
+	// returning an errors.NewCommandTimeout error (CodeCommandTimeout)
+	// if it fires.
+	Execute(ctx context.Context, request *Request) (stdout string, stderr string, exitCode int, err error)
+
+	// Cleanup releases any resources the engine is holding, e.g.
+	// containers, pods or temp directories.
+	Cleanup() error
+}
@@ -0,0 +1,65 @@
+package worker
+
+import (
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/operable/go-relay/relay/metrics"
+)
+
+// Pool manages the set of goroutines draining a Queue and lets the
+// pool be resized at runtime, e.g. when MaxConcurrent changes on a
+// config reload. Shrinking the pool never interrupts in-flight work:
+// a worker only notices it has been asked to drain once it finishes
+// its current request.
+type Pool struct {
+	queue       *Queue
+	coordinator *sync.WaitGroup
+	mu          sync.Mutex
+	drains      []chan struct{}
+}
+
+// NewPool creates a Pool of size workers draining queue.
+func NewPool(queue *Queue, coordinator *sync.WaitGroup, size int) *Pool {
+	pool := &Pool{queue: queue, coordinator: coordinator}
+	pool.Resize(size)
+	return pool
+}
+
+// Resize grows or shrinks the pool to size workers.
+func (p *Pool) Resize(size int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for len(p.drains) < size {
+		drain := make(chan struct{})
+		p.drains = append(p.drains, drain)
+		go runWorkerGuarded(p.queue, p.coordinator, drain)
+	}
+	for len(p.drains) > size {
+		last := len(p.drains) - 1
+		close(p.drains[last])
+		p.drains = p.drains[:last]
+	}
+}
+
+// Size returns the current number of workers in the pool.
+func (p *Pool) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.drains)
+}
+
+// runWorkerGuarded runs RunWorker with a recover() so that a panic
+// while executing one request marks the relay unhealthy instead of
+// crashing the whole process and silently dropping every other
+// in-flight request.
+func runWorkerGuarded(queue *Queue, coordinator *sync.WaitGroup, drain <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("Worker goroutine panicked: %v.", r)
+			metrics.MarkPanic()
+		}
+	}()
+	RunWorker(queue, coordinator, drain)
+}
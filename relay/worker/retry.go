@@ -0,0 +1,97 @@
+package worker
+
+import (
+	"encoding/json"
+	"math/rand"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	relayerrors "github.com/operable/go-relay/relay/errors"
+	"github.com/operable/go-relay/relay/metrics"
+)
+
+// DeadLetterEnvelope is the payload published to a request's
+// DeadLetterTopic once it is given up on, carrying the original
+// message plus enough failure metadata for an operator to replay it.
+type DeadLetterEnvelope struct {
+	Topic    string `json:"topic"`
+	Message  []byte `json:"message"`
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error"`
+}
+
+// BuildDeadLetterPayload marshals a DeadLetterEnvelope for topic,
+// message and attempts so every dead-letter publish site, whether a
+// request made it onto the queue or not, produces the same shape.
+func BuildDeadLetterPayload(topic string, message []byte, attempts int, cause error) ([]byte, error) {
+	return json.Marshal(DeadLetterEnvelope{
+		Topic:    topic,
+		Message:  message,
+		Attempts: attempts,
+		Error:    cause.Error(),
+	})
+}
+
+// handleFailure decides what happens to a request that just failed:
+// transient errors are requeued with jittered exponential backoff up
+// to MaxAttempts, everything else goes straight to the dead-letter
+// topic.
+func handleFailure(queue *Queue, request *Request, err error) {
+	if relayerrors.IsTransient(err) && request.Attempt < request.MaxAttempts {
+		request.Attempt++
+		delay := backoff(request.Attempt, request.BaseDelay, request.MaxDelay)
+		metrics.RetryAttempts.Inc()
+		log.Warnf("Retrying request on topic %s (retry %d/%d) in %s: %s.",
+			request.Topic, request.Attempt, request.MaxAttempts, delay, err)
+		time.AfterFunc(delay, func() { queue.Enqueue(request) })
+		return
+	}
+	deadLetter(request, err)
+}
+
+// backoff computes the jittered exponential delay before attempt,
+// doubling base each attempt and capping at max.
+func backoff(attempt int, base, max time.Duration) time.Duration {
+	if base <= 0 {
+		base = 500 * time.Millisecond
+	}
+	if max <= 0 {
+		max = 30 * time.Second
+	}
+	delay := base << uint(attempt-1)
+	if delay <= 0 || delay > max {
+		delay = max
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay)/2+1))
+}
+
+// deadLetter publishes request's terminal failure back to its
+// response topic so the caller waiting on it sees a structured error
+// instead of silence, then publishes it to its DeadLetterTopic along
+// with failure metadata so operators can inspect and replay it, or
+// simply logs and drops the request if no dead-letter topic is
+// configured.
+func deadLetter(request *Request, err error) {
+	if request.Bus != nil {
+		if pubErr := request.Bus.PublishError(request.Topic, err); pubErr != nil {
+			log.Errorf("Error publishing failure for topic %s: %s.", request.Topic, pubErr)
+		}
+	}
+	if request.DeadLetterTopic == "" || request.Bus == nil {
+		log.Errorf("Dropping request on topic %s after %d attempt(s): %s.",
+			request.Topic, request.Attempt+1, err)
+		return
+	}
+	payload, marshalErr := BuildDeadLetterPayload(request.Topic, request.Message, request.Attempt+1, err)
+	if marshalErr != nil {
+		log.Errorf("Error marshaling dead-letter envelope for topic %s: %s.", request.Topic, marshalErr)
+		return
+	}
+	log.Warnf("Publishing request on topic %s to dead-letter topic %s after %d attempt(s): %s.",
+		request.Topic, request.DeadLetterTopic, request.Attempt+1, err)
+	if pubErr := request.Bus.Publish(request.DeadLetterTopic, payload); pubErr != nil {
+		log.Errorf("Error publishing to dead-letter topic %s: %s.", request.DeadLetterTopic, pubErr)
+		return
+	}
+	metrics.DeadLetterCount.Inc()
+}
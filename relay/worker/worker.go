@@ -0,0 +1,156 @@
+// Package worker implements the relay's bounded work queue and the
+// goroutines that drain it to execute bundle commands.
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/operable/go-relay/relay/metrics"
+)
+
+// MessageBus is the subset of bus.Link that workers need in order to
+// publish responses back to Cog.
+type MessageBus interface {
+	Publish(topic string, payload []byte) error
+	PublishError(topic string, err error) error
+}
+
+// Service is implemented by long-lived relay components that need to
+// be halted during shutdown.
+type Service interface {
+	Halt()
+}
+
+// Request is a single unit of work pulled off the queue: a bundle
+// command invocation to execute and a bus to publish the result to.
+type Request struct {
+	Bus     MessageBus
+	Engine  ExecutionEngine
+	Topic   string
+	Message []byte
+
+	// Attempt is the number of times this request has already been
+	// tried; it is incremented by the retry subsystem and is zero on
+	// first execution.
+	Attempt int
+
+	// MaxAttempts, BaseDelay and MaxDelay bound the retry subsystem's
+	// exponential backoff for this request. A zero MaxAttempts
+	// disables retries entirely.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+
+	// DeadLetterTopic is where this request is published if it
+	// exhausts its retries or fails non-transiently. Empty disables
+	// dead-lettering.
+	DeadLetterTopic string
+
+	// CPUQuota, MemoryBytes and PidsLimit are the resource limits the
+	// engine should apply when running this command; Timeout is the
+	// wall-clock budget before it is killed. All are pre-clamped to
+	// the configured ceiling by the caller.
+	CPUQuota    int64
+	MemoryBytes int64
+	PidsLimit   int64
+	Timeout     time.Duration
+}
+
+// Queue is a bounded FIFO of pending Requests.
+type Queue struct {
+	items  chan *Request
+	closed chan struct{}
+	once   sync.Once
+}
+
+// NewQueue creates a Queue with room for capacity buffered requests.
+func NewQueue(capacity int) *Queue {
+	return &Queue{
+		items:  make(chan *Request, capacity),
+		closed: make(chan struct{}),
+	}
+}
+
+// Enqueue adds a request to the queue for a worker to pick up.
+func (q *Queue) Enqueue(request *Request) {
+	select {
+	case q.items <- request:
+		metrics.QueueEnqueued.Inc()
+		metrics.QueueDepth.Inc()
+	case <-q.closed:
+		log.Warn("Dropping request; work queue is stopped.")
+	}
+}
+
+// Stop closes the queue. Workers drain remaining requests and then
+// exit.
+func (q *Queue) Stop() {
+	q.once.Do(func() {
+		close(q.closed)
+		close(q.items)
+	})
+}
+
+// RunWorker pulls requests off queue and executes them until the
+// queue is stopped or drain is closed, then signals coordinator that
+// it has exited. drain lets the pool be shrunk on a config reload
+// without dropping in-flight work: a worker only checks it between
+// requests, so a job that is already running always finishes.
+func RunWorker(queue *Queue, coordinator *sync.WaitGroup, drain <-chan struct{}) {
+	coordinator.Add(1)
+	defer coordinator.Done()
+	for {
+		select {
+		case request, ok := <-queue.items:
+			if !ok {
+				return
+			}
+			metrics.QueueDequeued.Inc()
+			metrics.QueueDepth.Dec()
+			execute(queue, request)
+		case <-drain:
+			return
+		}
+	}
+}
+
+func execute(queue *Queue, request *Request) {
+	// TODO: unpack request.Message to find the bundle/command being
+	// invoked and its arguments, then publish the result to
+	// request.Bus.
+	bundle, command := requestLabels(request)
+	metrics.WorkerInFlight.Inc()
+	defer metrics.WorkerInFlight.Dec()
+	defer func() {
+		if cleanupErr := request.Engine.Cleanup(); cleanupErr != nil {
+			log.Errorf("Error cleaning up %s engine for topic %s: %s.", request.Engine.Name(), request.Topic, cleanupErr)
+		}
+	}()
+	start := time.Now()
+	log.Debugf("Executing request on topic %s via %s engine (attempt %d).", request.Topic, request.Engine.Name(), request.Attempt+1)
+	ctx := context.Background()
+	if request.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, request.Timeout)
+		defer cancel()
+	}
+	_, _, _, err := request.Engine.Execute(ctx, request)
+	metrics.CommandDuration.WithLabelValues(bundle, command).Observe(time.Since(start).Seconds())
+	result := "success"
+	if err != nil {
+		result = "failure"
+		handleFailure(queue, request, err)
+	}
+	metrics.CommandResults.WithLabelValues(bundle, command, result).Inc()
+}
+
+// requestLabels returns the bundle/command metric labels for a
+// request. The invocation envelope is not parsed (see the TODO in
+// execute), so the whole topic, e.g. "bot/relays/<id>/executions",
+// stands in for the bundle and command is always "unknown".
+func requestLabels(request *Request) (bundle, command string) {
+	return request.Topic, "unknown"
+}